@@ -0,0 +1,301 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CorrelationMetrics are the Prometheus metrics shared by every
+// CorrelationObserver across a run.
+type CorrelationMetrics struct {
+	endToEnd          *prometheus.HistogramVec
+	notificationDelay prometheus.Histogram
+	lost              prometheus.Counter
+	duplicated        prometheus.Counter
+}
+
+// NewCorrelationMetrics creates and registers the metrics a
+// CorrelationObserver reports.
+func NewCorrelationMetrics(reg prometheus.Registerer) *CorrelationMetrics {
+	m := &CorrelationMetrics{
+		endToEnd: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ambench_end_to_end_latency_seconds",
+			Help:    "Time from firing an alert to receiving a webhook notification for it.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"alertmanager", "group_key"}),
+		notificationDelay: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ambench_notification_delay_seconds",
+			Help:    "Maximum per-alert send-to-notify delay observed within a single notification.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		lost: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ambench_alerts_lost_total",
+			Help: "Number of alerts fired but never observed in a notification within the lost timeout.",
+		}),
+		duplicated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ambench_alerts_duplicated_total",
+			Help: "Number of alerts observed in more than one notification.",
+		}),
+	}
+	reg.MustRegister(m.endToEnd, m.notificationDelay, m.lost, m.duplicated)
+	return m
+}
+
+// correlationEntry records where and when a fingerprinted alert was last
+// fired, so a later notification can be matched back to its send.
+type correlationEntry struct {
+	hash         uint64
+	alertmanager string
+	sentAt       time.Time
+}
+
+// correlationLRU is a small fixed-capacity LRU cache keyed by alert
+// fingerprint.
+type correlationLRU struct {
+	mtx      sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[uint64]*list.Element
+}
+
+func newCorrelationLRU(capacity int) *correlationLRU {
+	return &correlationLRU{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    map[uint64]*list.Element{},
+	}
+}
+
+func (c *correlationLRU) Put(hash uint64, alertmanager string, at time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if el, ok := c.items[hash]; ok {
+		entry := el.Value.(*correlationEntry)
+		entry.alertmanager = alertmanager
+		entry.sentAt = at
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&correlationEntry{hash: hash, alertmanager: alertmanager, sentAt: at})
+	c.items[hash] = el
+
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*correlationEntry).hash)
+	}
+}
+
+// Take looks up and removes a fingerprint's entry, so it is only ever
+// matched once.
+func (c *correlationLRU) Take(hash uint64) (correlationEntry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	el, ok := c.items[hash]
+	if !ok {
+		return correlationEntry{}, false
+	}
+	c.ll.Remove(el)
+	delete(c.items, hash)
+	return *el.Value.(*correlationEntry), true
+}
+
+// Peek reports whether a fingerprint is present without removing it.
+func (c *correlationLRU) Peek(hash uint64) (correlationEntry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	el, ok := c.items[hash]
+	if !ok {
+		return correlationEntry{}, false
+	}
+	c.ll.MoveToFront(el)
+	return *el.Value.(*correlationEntry), true
+}
+
+// PopOlderThan removes and returns entries whose sentAt is at or before
+// cutoff, walking from the least recently used end and stopping at the
+// first entry newer than cutoff; an older entry that sits in front of a
+// newer one in LRU order is left for a later call.
+func (c *correlationLRU) PopOlderThan(cutoff time.Time) []correlationEntry {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var popped []correlationEntry
+	for {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		entry := back.Value.(*correlationEntry)
+		if entry.sentAt.After(cutoff) {
+			break
+		}
+		c.ll.Remove(back)
+		delete(c.items, entry.hash)
+		popped = append(popped, *entry)
+	}
+	return popped
+}
+
+// CorrelationObserver matches fires to the notifications they eventually
+// produce, keyed by hashAlert fingerprint, and reports end-to-end latency,
+// lost and duplicated alerts.
+type CorrelationObserver struct {
+	metrics     *CorrelationMetrics
+	lostTimeout time.Duration
+
+	pending   *correlationLRU
+	delivered *correlationLRU
+
+	mtx     sync.Mutex
+	samples []float64
+
+	lost       int64
+	duplicated int64
+}
+
+func NewCorrelationObserver(metrics *CorrelationMetrics, capacity int, lostTimeout time.Duration) *CorrelationObserver {
+	return &CorrelationObserver{
+		metrics:     metrics,
+		lostTimeout: lostTimeout,
+		pending:     newCorrelationLRU(capacity),
+		delivered:   newCorrelationLRU(capacity),
+	}
+}
+
+func (o *CorrelationObserver) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	switch event {
+	case AlertSent, AlertResolved:
+		am, _ := meta["alertmanager"].(string)
+		sentAt, ok := meta["timestamp"].(time.Time)
+		if !ok {
+			sentAt = time.Now()
+		}
+		for _, a := range alerts {
+			o.pending.Put(hashAlert(a), am, sentAt)
+		}
+	case NotificationReceived:
+		o.observeNotification(alerts, meta)
+	}
+}
+
+// observeNotification writes "latency_ns" back into meta on a match, for
+// an EventStoreObserver later in the same fan-out to pick up.
+func (o *CorrelationObserver) observeNotification(alerts []*Alert, meta map[string]interface{}) {
+	groupKey, _ := meta["groupKey"].(string)
+	now := time.Now()
+
+	var maxDelay time.Duration
+	for _, a := range alerts {
+		hash := hashAlert(a)
+
+		if entry, ok := o.pending.Take(hash); ok {
+			delay := now.Sub(entry.sentAt)
+			o.metrics.endToEnd.WithLabelValues(entry.alertmanager, groupKey).Observe(delay.Seconds())
+			o.recordSample(delay.Seconds())
+			if delay > maxDelay {
+				maxDelay = delay
+			}
+			o.delivered.Put(hash, entry.alertmanager, now)
+			continue
+		}
+
+		if _, ok := o.delivered.Peek(hash); ok {
+			o.metrics.duplicated.Inc()
+			atomic.AddInt64(&o.duplicated, 1)
+		}
+	}
+
+	if maxDelay > 0 {
+		o.metrics.notificationDelay.Observe(maxDelay.Seconds())
+		meta["latency_ns"] = maxDelay.Nanoseconds()
+	}
+}
+
+func (o *CorrelationObserver) recordSample(seconds float64) {
+	o.mtx.Lock()
+	o.samples = append(o.samples, seconds)
+	o.mtx.Unlock()
+}
+
+// reapLoop periodically removes pending fires older than lostTimeout,
+// counting them as lost, until stopc is closed.
+func (o *CorrelationObserver) reapLoop(stopc <-chan struct{}) {
+	interval := o.lostTimeout / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			o.reap(time.Now())
+		case <-stopc:
+			o.reap(time.Now())
+			return
+		}
+	}
+}
+
+func (o *CorrelationObserver) reap(now time.Time) {
+	popped := o.pending.PopOlderThan(now.Add(-o.lostTimeout))
+	if len(popped) == 0 {
+		return
+	}
+	o.metrics.lost.Add(float64(len(popped)))
+	atomic.AddInt64(&o.lost, int64(len(popped)))
+}
+
+// Summary renders the p50/p95/p99 end-to-end latency plus lost and
+// duplicated counts observed during this run, for the text report.
+func (o *CorrelationObserver) Summary() string {
+	o.mtx.Lock()
+	samples := make([]float64, len(o.samples))
+	copy(samples, o.samples)
+	o.mtx.Unlock()
+
+	sort.Float64s(samples)
+
+	return fmt.Sprintf(
+		"LATENCY_SUMMARY p50=%s p95=%s p99=%s lost=%d duplicated=%d\n",
+		formatSeconds(percentile(samples, 0.50)),
+		formatSeconds(percentile(samples, 0.95)),
+		formatSeconds(percentile(samples, 0.99)),
+		atomic.LoadInt64(&o.lost),
+		atomic.LoadInt64(&o.duplicated),
+	)
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).String()
+}
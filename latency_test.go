@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCorrelationLRUTakeRemoves(t *testing.T) {
+	c := newCorrelationLRU(10)
+	now := time.Now()
+	c.Put(1, "am1", now)
+
+	entry, ok := c.Take(1)
+	if !ok || entry.alertmanager != "am1" {
+		t.Fatalf("expected to take entry for hash 1, got %+v, %v", entry, ok)
+	}
+
+	if _, ok := c.Take(1); ok {
+		t.Fatalf("expected second Take to miss, entry should have been removed")
+	}
+}
+
+func TestCorrelationLRUPeekDoesNotRemove(t *testing.T) {
+	c := newCorrelationLRU(10)
+	now := time.Now()
+	c.Put(1, "am1", now)
+
+	if _, ok := c.Peek(1); !ok {
+		t.Fatalf("expected Peek to find hash 1")
+	}
+	if _, ok := c.Peek(1); !ok {
+		t.Fatalf("expected Peek to still find hash 1 after a prior Peek")
+	}
+}
+
+func TestCorrelationLRUEvictsOldestOverCapacity(t *testing.T) {
+	c := newCorrelationLRU(2)
+	now := time.Now()
+	c.Put(1, "am1", now)
+	c.Put(2, "am1", now)
+	c.Put(3, "am1", now)
+
+	if _, ok := c.Peek(1); ok {
+		t.Fatalf("expected hash 1 to have been evicted")
+	}
+	if _, ok := c.Peek(2); !ok {
+		t.Fatalf("expected hash 2 to still be present")
+	}
+	if _, ok := c.Peek(3); !ok {
+		t.Fatalf("expected hash 3 to still be present")
+	}
+}
+
+func TestCorrelationLRUPopOlderThan(t *testing.T) {
+	c := newCorrelationLRU(10)
+	old := time.Now().Add(-time.Hour)
+	recent := time.Now()
+	c.Put(1, "am1", old)
+	c.Put(2, "am1", recent)
+
+	popped := c.PopOlderThan(time.Now().Add(-time.Minute))
+	if len(popped) != 1 || popped[0].hash != 1 {
+		t.Fatalf("expected to pop only hash 1, got %+v", popped)
+	}
+	if _, ok := c.Peek(2); !ok {
+		t.Fatalf("expected hash 2 to remain after PopOlderThan")
+	}
+}
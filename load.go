@@ -2,15 +2,15 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,9 +22,11 @@ import (
 
 var TimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
 
-func RunLoadTests(done chan<- struct{}, r *WebhookReceiver, config LoadTestConfigs, alertmanagers []string, alertsFired *prometheus.CounterVec) error {
+func RunLoadTests(done chan<- struct{}, r *WebhookReceiver, config LoadTestConfigs, alertmanagers []string, alertsFired *prometheus.CounterVec, notifierMetrics *NotifierMetrics, promObserver *PrometheusObserver, correlationMetrics *CorrelationMetrics, probeMetrics *ProbeMetrics) error {
 
 	for _, c := range config.LoadTestConfigs {
+		logger := slog.With("test", c.Name)
+
 		resultDirPath := filepath.Join("test_results", c.Name)
 		os.MkdirAll(resultDirPath, os.ModePerm)
 		reportFilePath := filepath.Join(resultDirPath, "report")
@@ -33,6 +35,12 @@ func RunLoadTests(done chan<- struct{}, r *WebhookReceiver, config LoadTestConfi
 			return err
 		}
 
+		jsonReportFilePath := filepath.Join(resultDirPath, "report.jsonl")
+		jsonReportFile, err := os.OpenFile(jsonReportFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+
 		df, err := os.Open(c.DatasetFile)
 		if err != nil {
 			return err
@@ -41,21 +49,71 @@ func RunLoadTests(done chan<- struct{}, r *WebhookReceiver, config LoadTestConfi
 
 		c.dataset = d
 		c.alertmanagers = alertmanagers
-		c.alertsFired = alertsFired
+
+		store := newAlertsFiredEventStore()
+		correlation := NewCorrelationObserver(correlationMetrics, c.correlationCapacity(), c.lostTimeout())
+		reapStop := make(chan struct{})
+		go correlation.reapLoop(reapStop)
+
+		// correlation runs first so it can attach "latency_ns" to the shared
+		// meta map before EventStoreObserver records the notification event.
+		observers := Observers{correlation, NewEventStoreObserver(store, r.notifications, alertsFired)}
+
+		var probe *AlertmanagerProbe
+		var probeStop chan struct{}
+		if c.Probe != nil {
+			probe = NewAlertmanagerProbe(c.Probe.resolve(), probeMetrics, logger.With("component", "probe"))
+			observers = append(observers, probe)
+			probeStop = make(chan struct{})
+			go probe.Run(c.alertmanagers, probeStop)
+		}
+
+		closers := []io.Closer{}
+		for _, oc := range c.Observers {
+			switch oc.Type {
+			case "jsonl":
+				f, err := os.OpenFile(filepath.Join(resultDirPath, oc.Path), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+				if err != nil {
+					return err
+				}
+				observers = append(observers, NewJSONLinesObserver(f))
+				closers = append(closers, f)
+			case "prometheus":
+				observers = append(observers, promObserver)
+			default:
+				return fmt.Errorf("unknown observer type %q", oc.Type)
+			}
+		}
+		r.SetObserver(observers)
 
 		// run load test and validate result from webhook receiver
-		lt := NewLoadTest(c)
+		lt := NewLoadTest(c, notifierMetrics, observers, logger)
 		lt.Run()
 
 		time.Sleep(10 * time.Second)
+		close(reapStop)
 
-		alertsFiredEvents := lt.Events()
+		var probeEvents []Event
+		if probe != nil {
+			close(probeStop)
+			probeEvents = probeEventsSorted(probe.store)
+		}
+
+		alertsFiredEvents := alertsFiredEventsSorted(store)
 		notificationsReceivedEvents := r.Events()
-		events := mergeSortEvents(append(alertsFiredEvents, notificationsReceivedEvents))
+		events := mergeSortEvents([][]Event{alertsFiredEvents, notificationsReceivedEvents, probeEvents})
+
+		jsonEnc := json.NewEncoder(jsonReportFile)
 		for _, e := range events {
 			e.Print(reportFile)
+			jsonEnc.Encode(e.JSON())
 		}
+		fmt.Fprint(reportFile, correlation.Summary())
 		reportFile.Close()
+		jsonReportFile.Close()
+		for _, cl := range closers {
+			cl.Close()
+		}
 
 		r.ResetEvents()
 	}
@@ -69,128 +127,279 @@ type LoadTestConfigs struct {
 }
 
 type LoadTestConfig struct {
-	Name             string         `yaml:"name"`
-	Duration         model.Duration `yaml:"duration"`
-	Goroutines       int            `yaml:"goroutines"`
-	BatchSize        int            `yaml:"batch_size"`
-	RotationInterval int            `yaml:"rotation_interval"`
-	FireInterval     model.Duration `yaml:"fire_interval"`
-	DatasetFile      string         `yaml:"dataset_file"`
-	dataset          *Dataset
-	alertmanagers    []string
-	alertsFired      *prometheus.CounterVec
+	Name                string           `yaml:"name"`
+	Duration            model.Duration   `yaml:"duration"`
+	Goroutines          int              `yaml:"goroutines"`
+	BatchSize           int              `yaml:"batch_size"`
+	RotationInterval    int              `yaml:"rotation_interval"`
+	FireInterval        model.Duration   `yaml:"fire_interval"`
+	DatasetFile         string           `yaml:"dataset_file"`
+	QueueCapacity       int              `yaml:"queue_capacity"`
+	MaxBatchSize        int              `yaml:"max_batch_size"`
+	SendTimeout         model.Duration   `yaml:"send_timeout"`
+	RetryBackoff        model.Duration   `yaml:"retry_backoff"`
+	Workers             int              `yaml:"workers"`
+	APIVersion          string           `yaml:"api_version"`
+	ResolveAfter        model.Duration   `yaml:"resolve_after"`
+	Observers           []ObserverConfig `yaml:"observers"`
+	CorrelationCapacity int              `yaml:"correlation_capacity"`
+	LostTimeout         model.Duration   `yaml:"lost_timeout"`
+	Probe               *ProbeSettings   `yaml:"probe"`
+	dataset             *Dataset
+	alertmanagers       []string
+}
+
+// defaultCorrelationCapacity bounds the end-to-end correlation LRU when
+// correlation_capacity isn't set.
+const defaultCorrelationCapacity = 100000
+
+// defaultLostTimeout is how long a fired alert is tracked before being
+// counted lost when lost_timeout isn't set.
+const defaultLostTimeout = 5 * time.Minute
+
+func (c *LoadTestConfig) correlationCapacity() int {
+	if c.CorrelationCapacity == 0 {
+		return defaultCorrelationCapacity
+	}
+	return c.CorrelationCapacity
+}
+
+func (c *LoadTestConfig) lostTimeout() time.Duration {
+	if c.LostTimeout == 0 {
+		return defaultLostTimeout
+	}
+	return time.Duration(c.LostTimeout)
+}
+
+// ObserverConfig selects and configures one additional Observer to compose
+// alongside the default in-memory event store for a load test run.
+type ObserverConfig struct {
+	Type string `yaml:"type"` // "jsonl" or "prometheus"
+	Path string `yaml:"path"` // file path for type: jsonl, relative to the test's result dir
 }
 
 type LoadTest struct {
-	c   *LoadTestConfig
-	lps []*LoadProducer
+	c        *LoadTestConfig
+	lps      []*LoadProducer
+	notifier *Notifier
+	logger   *slog.Logger
 }
 
-func NewLoadTest(c *LoadTestConfig) *LoadTest {
-	lps := []*LoadProducer{}
+// apiVersion defaults an unset APIVersion to the long-standing v1 behavior.
+func (c *LoadTestConfig) apiVersion() string {
+	if c.APIVersion == "" {
+		return "v1"
+	}
+	return c.APIVersion
+}
+
+// Defaults for the Notifier knobs below when a LoadTestConfig doesn't set
+// them, so an unset value degrades to a working notifier rather than one
+// with zero workers or an already-expired send timeout.
+const (
+	defaultWorkers       = 1
+	defaultQueueCapacity = 1000
+	defaultMaxBatchSize  = 100
+	defaultSendTimeout   = 10 * time.Second
+	defaultRetryBackoff  = time.Second
+)
 
+func (c *LoadTestConfig) workers() int {
+	if c.Workers == 0 {
+		return defaultWorkers
+	}
+	return c.Workers
+}
+
+func (c *LoadTestConfig) queueCapacity() int {
+	if c.QueueCapacity == 0 {
+		return defaultQueueCapacity
+	}
+	return c.QueueCapacity
+}
+
+func (c *LoadTestConfig) maxBatchSize() int {
+	if c.MaxBatchSize == 0 {
+		return defaultMaxBatchSize
+	}
+	return c.MaxBatchSize
+}
+
+func (c *LoadTestConfig) sendTimeout() time.Duration {
+	if c.SendTimeout == 0 {
+		return defaultSendTimeout
+	}
+	return time.Duration(c.SendTimeout)
+}
+
+func (c *LoadTestConfig) retryBackoff() time.Duration {
+	if c.RetryBackoff == 0 {
+		return defaultRetryBackoff
+	}
+	return time.Duration(c.RetryBackoff)
+}
+
+// alertEndpoints resolves the configured alertmanager base URLs to the
+// alerts endpoint of the version this test targets.
+func (c *LoadTestConfig) alertEndpoints() []string {
+	version := c.apiVersion()
+	endpoints := make([]string, len(c.alertmanagers))
+	for i, am := range c.alertmanagers {
+		endpoints[i] = strings.TrimRight(am, "/") + "/api/" + version + "/alerts"
+	}
+	return endpoints
+}
+
+func NewLoadTest(c *LoadTestConfig, notifierMetrics *NotifierMetrics, observer Observer, logger *slog.Logger) *LoadTest {
+	endpoints := c.alertEndpoints()
+
+	notifier := NewNotifier(NotifierConfig{
+		QueueCapacity: c.queueCapacity(),
+		MaxBatchSize:  c.maxBatchSize(),
+		SendTimeout:   c.sendTimeout(),
+		RetryBackoff:  c.retryBackoff(),
+		Workers:       c.workers(),
+	}, notifierMetrics, observer, logger.With("component", "notifier"))
+
+	lps := []*LoadProducer{}
 	for i := 0; i < c.Goroutines; i++ {
 		ap := &AlertProducer{
-			dataset:  c.dataset,
-			index:    i * (c.BatchSize),
-			batch:    c.BatchSize,
-			interval: c.RotationInterval,
+			dataset:      c.dataset,
+			index:        i * (c.BatchSize),
+			batch:        c.BatchSize,
+			interval:     c.RotationInterval,
+			resolveAfter: time.Duration(c.ResolveAfter),
+			active:       map[int]*activeBatch{},
 		}
 
 		lp := &LoadProducer{
-			alertsFired:   c.alertsFired,
-			alertmanagers: c.alertmanagers,
+			alertmanagers: endpoints,
 			alertProducer: ap,
 			fireInterval:  time.Duration(c.FireInterval),
+			notifier:      notifier,
 		}
 
 		lps = append(lps, lp)
 	}
 
 	return &LoadTest{
-		c:   c,
-		lps: lps,
+		c:        c,
+		lps:      lps,
+		notifier: notifier,
+		logger:   logger,
 	}
 }
 
 func (lt *LoadTest) Run() {
-	log.Println("Start load test:", lt.c.Name)
+	lt.logger.Info("starting load test")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Duration(lt.c.Duration))
+	defer cancel()
 
-	ctx, _ := context.WithTimeout(context.TODO(), time.Duration(lt.c.Duration))
+	go lt.notifier.Run(lt.c.alertEndpoints(), ctx.Done())
 
 	for _, lp := range lt.lps {
 		go lp.Run(ctx.Done())
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Load test done:", lt.c.Name)
-			return
-		}
-	}
+	<-ctx.Done()
+	lt.logger.Info("load test finished")
 }
 
 func mergeSortEvents(e [][]Event) []Event {
 	events := []Event{}
 	indices := make([]int, len(e))
-	min := 0
+	min := -1
 
 	for len(e) != 0 {
 		for i := range e {
-			curIndex := indices[i]
-			curEvents := e[i]
-			if len(curEvents) == 0 {
+			if len(e[i]) == 0 {
 				continue
 			}
-			cur := curEvents[curIndex]
-			curMinEvents := e[min]
-			curMin := curMinEvents[indices[min]]
-			if cur.Timestamp().Before(curMin.Timestamp()) {
+			if min == -1 || e[i][indices[i]].Timestamp().Before(e[min][indices[min]].Timestamp()) {
 				min = i
 			}
 		}
-		minEvents := e[min]
-		minIndex := indices[min]
-		if len(minEvents)-1 >= minIndex {
-			events = append(events, minEvents[minIndex])
+		if min == -1 {
+			// every remaining slice is empty.
+			break
 		}
+
+		events = append(events, e[min][indices[min]])
 		indices[min]++
 		if indices[min] >= len(e[min]) {
 			e = append(e[:min], e[min+1:]...)
 			indices = append(indices[:min], indices[min+1:]...)
-			min = 0
 		}
+		min = -1
 	}
 
 	return events
 }
 
-func (lt *LoadTest) Events() [][]Event {
-	e := make([][]Event, len(lt.lps))
-
-	for i, lp := range lt.lps {
-		e[i] = make([]Event, len(lp.eventStore))
-		for j, ev := range lp.eventStore {
-			e[i][j] = Event(ev)
-		}
+// alertsFiredEventsSorted returns a time-sorted snapshot of an
+// alertsFiredEventStore for merging into the report, since it's populated
+// concurrently by the notifier's worker goroutines.
+func alertsFiredEventsSorted(store *alertsFiredEventStore) []Event {
+	events := store.All()
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].timestamp.Before(events[j].timestamp)
+	})
+
+	e := make([]Event, len(events))
+	for i, ev := range events {
+		e[i] = Event(ev)
 	}
 
 	return e
 }
 
 type Alert struct {
-	Labels map[string]string `json:"labels,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
 }
 
 type alertsFiredEvent struct {
 	alertmanager string
 	alerts       []*Alert
 	timestamp    time.Time
+	eventType    string
+}
+
+// alertsFiredEventStore collects alertsFiredEvents from the notifier's
+// worker goroutines, which send concurrently across alertmanagers and
+// producers.
+type alertsFiredEventStore struct {
+	mtx    *sync.Mutex
+	events []*alertsFiredEvent
+}
+
+func newAlertsFiredEventStore() *alertsFiredEventStore {
+	return &alertsFiredEventStore{
+		events: []*alertsFiredEvent{},
+		mtx:    &sync.Mutex{},
+	}
+}
+
+func (s *alertsFiredEventStore) Add(e *alertsFiredEvent) {
+	s.mtx.Lock()
+	s.events = append(s.events, e)
+	s.mtx.Unlock()
+}
+
+func (s *alertsFiredEventStore) All() []*alertsFiredEvent {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	events := make([]*alertsFiredEvent, len(s.events))
+	copy(events, s.events)
+	return events
 }
 
 func (e *alertsFiredEvent) Print(out io.Writer) {
-	fmt.Fprint(out, "ALERTS       ")
+	fmt.Fprintf(out, "%-12s ", e.eventType)
 	fmt.Fprint(out, e.timestamp.UTC().Format(TimeFormat), " ")
 	fmt.Fprint(out, e.alertmanager, " ")
 	hashes := alertHashes(e.alerts)
@@ -204,12 +413,25 @@ func (e *alertsFiredEvent) Timestamp() time.Time {
 	return e.timestamp
 }
 
+func (e *alertsFiredEvent) JSON() jsonReportEvent {
+	hashes := alertHashes(e.alerts)
+	hexHashes := make([]string, len(hashes))
+	for i, h := range hashes {
+		hexHashes[i] = fmt.Sprintf("%x", h)
+	}
+	return jsonReportEvent{
+		Type:         e.eventType,
+		TsNanos:      e.timestamp.UnixNano(),
+		Alertmanager: e.alertmanager,
+		AlertHashes:  hexHashes,
+	}
+}
+
 type LoadProducer struct {
-	alertsFired   *prometheus.CounterVec
 	alertmanagers []string
 	alertProducer *AlertProducer
 	fireInterval  time.Duration
-	eventStore    []*alertsFiredEvent
+	notifier      *Notifier
 }
 
 func (p *LoadProducer) Run(stopc <-chan struct{}) {
@@ -219,58 +441,136 @@ func (p *LoadProducer) Run(stopc <-chan struct{}) {
 		select {
 		case <-t.C:
 			p.fireAlerts()
+			p.resolveAlerts()
 		case <-stopc:
 			return
 		}
 	}
 }
 
+// fireAlerts hands a batch of alerts to the notifier for every configured
+// alertmanager; batching, retries and backoff happen there.
 func (p *LoadProducer) fireAlerts() {
 	alerts := p.alertProducer.makeAlerts()
-	b := bytes.NewBuffer(nil)
-	json.NewEncoder(b).Encode(alerts)
-	jsonBlob := b.Bytes()
 	for _, am := range p.alertmanagers {
-		buf := make([]byte, len(jsonBlob))
-		copy(buf, jsonBlob)
-		resp, err := http.Post(am, "application/json", bytes.NewBuffer(buf))
-		if err != nil {
-			panic(err)
+		p.notifier.Send(am, alerts)
+	}
+}
+
+// resolveAlerts sends an EndsAt=now resolve for every batch that's been
+// abandoned past resolveAfter.
+func (p *LoadProducer) resolveAlerts() {
+	now := time.Now()
+	for _, alerts := range p.alertProducer.dueForResolve(now) {
+		resolved := make([]*Alert, len(alerts))
+		for i, a := range alerts {
+			r := *a
+			r.EndsAt = &now
+			resolved[i] = &r
+		}
+		for _, am := range p.alertmanagers {
+			p.notifier.Send(am, resolved)
 		}
-		resp.Body.Close()
-		p.alertsFired.WithLabelValues(am, fmt.Sprintf("%d", resp.StatusCode)).Inc()
-		p.eventStore = append(p.eventStore, &alertsFiredEvent{alertmanager: am, alerts: alerts, timestamp: time.Now()})
 	}
 }
 
+// activeBatch tracks a rotation of the dataset AlertProducer is firing (or
+// has just stopped firing), pending resolution.
+type activeBatch struct {
+	alerts   []*Alert
+	lastSeen time.Time
+	retired  bool
+}
+
 type AlertProducer struct {
 	dataset       *Dataset
 	index         int
 	batch         int
 	interval      int
 	batchRepeated int
+	resolveAfter  time.Duration
+
+	mtx    sync.Mutex
+	active map[int]*activeBatch
 }
 
 func (p *AlertProducer) makeAlerts() []*Alert {
 	if p.batchRepeated == p.interval {
+		p.retire(p.index)
 		p.index += p.batch
 		p.batchRepeated = 0
 	}
 
 	alerts := []*Alert{}
 	labelsets := p.dataset.Get(p.index, p.index+p.batch)
+	startsAt := time.Now()
 	for _, labels := range labelsets {
-		alert := &Alert{Labels: map[string]string{}}
+		alert := &Alert{Labels: map[string]string{}, StartsAt: startsAt}
 		for _, l := range *labels {
 			alert.Labels[l.Name] = l.Value
 		}
 		alerts = append(alerts, alert)
 	}
 
+	p.renew(p.index, alerts)
+
 	p.batchRepeated++
 	return alerts
 }
 
+// renew keeps a still-firing batch's original StartsAt, so repeated fires
+// don't look like new alerts. With resolveAfter 0 no batch is tracked and
+// each fire keeps the StartsAt it was made with.
+func (p *AlertProducer) renew(index int, alerts []*Alert) {
+	if p.resolveAfter == 0 {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if b, ok := p.active[index]; ok && len(b.alerts) > 0 {
+		startsAt := b.alerts[0].StartsAt
+		for _, a := range alerts {
+			a.StartsAt = startsAt
+		}
+	}
+	p.active[index] = &activeBatch{alerts: alerts, lastSeen: time.Now()}
+}
+
+// retire marks the batch at index as no longer being actively fired, so it
+// becomes eligible for resolution once resolveAfter elapses.
+func (p *AlertProducer) retire(index int) {
+	if p.resolveAfter == 0 {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if b, ok := p.active[index]; ok {
+		b.retired = true
+	}
+}
+
+// dueForResolve returns the alert batches that have been retired and have
+// sat unrenewed past resolveAfter, removing them from tracking.
+func (p *AlertProducer) dueForResolve(now time.Time) [][]*Alert {
+	if p.resolveAfter == 0 {
+		return nil
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var due [][]*Alert
+	for index, b := range p.active {
+		if b.retired && now.Sub(b.lastSeen) >= p.resolveAfter {
+			due = append(due, b.alerts)
+			delete(p.active, index)
+		}
+	}
+	return due
+}
+
 type Dataset struct {
 	scanner *bufio.Scanner
 	dataset []*labels.Labels
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+type fakeEvent struct {
+	name string
+	ts   time.Time
+}
+
+func (e fakeEvent) Print(io.Writer)       {}
+func (e fakeEvent) Timestamp() time.Time  { return e.ts }
+func (e fakeEvent) JSON() jsonReportEvent { return jsonReportEvent{} }
+
+func TestMergeSortEventsSkipsEmptySlices(t *testing.T) {
+	now := time.Now()
+	a := []Event{fakeEvent{name: "a0", ts: now}, fakeEvent{name: "a1", ts: now.Add(2 * time.Second)}}
+	b := []Event{fakeEvent{name: "b0", ts: now.Add(time.Second)}}
+	empty := []Event(nil)
+
+	merged := mergeSortEvents([][]Event{empty, a, b})
+
+	want := []string{"a0", "b0", "a1"}
+	if len(merged) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(merged))
+	}
+	for i, e := range merged {
+		if got := e.(fakeEvent).name; got != want[i] {
+			t.Fatalf("event %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestMergeSortEventsAllEmpty(t *testing.T) {
+	merged := mergeSortEvents([][]Event{nil, {}, nil})
+	if len(merged) != 0 {
+		t.Fatalf("expected no events, got %d", len(merged))
+	}
+}
+
+func TestAlertProducerResolveLifecycle(t *testing.T) {
+	p := &AlertProducer{
+		resolveAfter: time.Minute,
+		active:       map[int]*activeBatch{},
+	}
+
+	startsAt := time.Now()
+	first := []*Alert{{Labels: map[string]string{"a": "1"}, StartsAt: startsAt}}
+	p.renew(0, first)
+
+	if due := p.dueForResolve(time.Now()); len(due) != 0 {
+		t.Fatalf("expected no batches due before retire, got %d", len(due))
+	}
+
+	renewed := []*Alert{{Labels: map[string]string{"a": "1"}}}
+	p.renew(0, renewed)
+	if !renewed[0].StartsAt.Equal(startsAt) {
+		t.Fatalf("renew should preserve original StartsAt, got %v want %v", renewed[0].StartsAt, startsAt)
+	}
+
+	p.retire(0)
+	if due := p.dueForResolve(time.Now()); len(due) != 0 {
+		t.Fatalf("expected no batches due immediately after retire, got %d", len(due))
+	}
+
+	due := p.dueForResolve(time.Now().Add(2 * time.Minute))
+	if len(due) != 1 {
+		t.Fatalf("expected 1 batch due for resolve, got %d", len(due))
+	}
+	if len(p.active) != 0 {
+		t.Fatalf("dueForResolve should remove resolved batches from tracking, %d left", len(p.active))
+	}
+}
+
+func TestAlertProducerResolveAfterDisabled(t *testing.T) {
+	p := &AlertProducer{active: map[int]*activeBatch{}}
+
+	p.renew(0, []*Alert{{Labels: map[string]string{"a": "1"}}})
+	p.retire(0)
+
+	if due := p.dueForResolve(time.Now().Add(time.Hour)); due != nil {
+		t.Fatalf("expected no batches tracked when resolveAfter is 0, got %v", due)
+	}
+}
@@ -4,13 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"path"
 	"strings"
 	"syscall"
 
@@ -24,8 +23,15 @@ func Main() int {
 	loadtestConfig := flag.String("config", "loadtests.yaml", "Load test configuration(s).")
 	ams := flag.String("alertmanagers", "", "Alertmanagers to fire alerts against.")
 	noload := flag.Bool("noload", false, "Disable load producing.")
+	logFormat := flag.String("log-format", "text", "Log format, one of: text, json.")
+	logLevel := flag.String("log-level", "info", "Log level, one of: debug, info, warn, error.")
 	flag.Parse()
 
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		fmt.Fprint(os.Stderr, "invalid logging configuration: ", err)
+		return 1
+	}
+
 	alertmanagers := []string{}
 	for _, am := range strings.Split(*ams, ",") {
 		u, err := url.Parse(am)
@@ -34,9 +40,6 @@ func Main() int {
 			return 1
 		}
 		u.Path = strings.TrimRight(u.Path, "/")
-		if u.Path == "" {
-			u.Path = path.Join(u.Path, "api/v1/alerts")
-		}
 		alertmanagers = append(alertmanagers, u.String())
 	}
 
@@ -70,11 +73,15 @@ func Main() int {
 	)
 	r.MustRegister(alertsFired)
 	r.MustRegister(notificationsReceived)
+	notifierMetrics := NewNotifierMetrics(r)
+	promObserver := NewPrometheusObserver(r)
+	correlationMetrics := NewCorrelationMetrics(r)
+	probeMetrics := NewProbeMetrics(r)
 
 	done := make(chan struct{}, 1)
 	whr := NewWebhookReceiver(notificationsReceived)
 	if !*noload {
-		go RunLoadTests(done, whr, config, alertmanagers, alertsFired)
+		go RunLoadTests(done, whr, config, alertmanagers, alertsFired, notifierMetrics, promObserver, correlationMetrics, probeMetrics)
 	}
 
 	mux := http.NewServeMux()
@@ -94,14 +101,38 @@ func Main() int {
 
 	select {
 	case <-term:
-		log.Println("Received SIGTERM, exiting gracefully...")
+		slog.Info("received SIGTERM, exiting gracefully")
 	case <-done:
-		log.Println("All load tests ran. Exiting.")
+		slog.Info("all load tests ran, exiting")
 	}
 
 	return 0
 }
 
+// setupLogging builds the slog handler Main() and everything it calls log
+// through for the rest of the process, from the --log-format and
+// --log-level flags.
+func setupLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
 func main() {
 	os.Exit(Main())
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxSendRetries bounds how many times a Notifier retries a single batch
+// before giving up and counting it as dropped. There is no config knob for
+// this (yet) since it mirrors the fixed retry ceiling Prometheus's own
+// notifier applies per alert group.
+const maxSendRetries = 3
+
+// NotifierConfig controls the queueing, batching and retry behavior of a
+// Notifier.
+type NotifierConfig struct {
+	QueueCapacity int
+	MaxBatchSize  int
+	SendTimeout   time.Duration
+	RetryBackoff  time.Duration
+	Workers       int
+}
+
+// NotifierMetrics are the Prometheus metrics exposed by a Notifier, all
+// labeled by destination alertmanager.
+type NotifierMetrics struct {
+	sendDuration *prometheus.HistogramVec
+	queueLength  *prometheus.GaugeVec
+	retries      *prometheus.CounterVec
+	dropped      *prometheus.CounterVec
+}
+
+// NewNotifierMetrics creates and registers the metrics a Notifier reports.
+func NewNotifierMetrics(reg prometheus.Registerer) *NotifierMetrics {
+	m := &NotifierMetrics{
+		sendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ambench_notifier_send_duration_seconds",
+			Help:    "Duration of sending a batch of alerts to an alertmanager.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"alertmanager"}),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ambench_notifier_queue_length",
+			Help: "Number of alert batches currently queued for an alertmanager.",
+		}, []string{"alertmanager"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ambench_notifier_retries_total",
+			Help: "Number of retried sends to an alertmanager.",
+		}, []string{"alertmanager"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ambench_notifier_dropped_total",
+			Help: "Number of alerts dropped because a queue was full or sending failed permanently.",
+		}, []string{"alertmanager"}),
+	}
+	reg.MustRegister(m.sendDuration, m.queueLength, m.retries, m.dropped)
+	return m
+}
+
+// Notifier owns a bounded, per-alertmanager queue and drains it with a pool
+// of worker goroutines that batch, retry with exponential backoff and
+// jitter, and drop alerts on overflow or permanent failure. It is modeled on
+// prometheus/notifier and Thanos's pkg/alert sender.
+type Notifier struct {
+	cfg      NotifierConfig
+	client   *http.Client
+	metrics  *NotifierMetrics
+	observer Observer
+	logger   *slog.Logger
+
+	mtx    sync.Mutex
+	queues map[string]chan queuedAlerts
+}
+
+// alertKind tags a queuedAlerts batch with the event it reports, so the
+// worker's drain loop can tell fires and resolves apart even after they've
+// been coalesced from separate Send calls.
+type alertKind int
+
+const (
+	alertKindFire alertKind = iota
+	alertKindResolve
+)
+
+// queuedAlerts is what flows through a Notifier's per-alertmanager queue.
+type queuedAlerts struct {
+	kind   alertKind
+	alerts []*Alert
+}
+
+// NewNotifier creates a Notifier. observer is notified of AlertQueued,
+// AlertSent, AlertResolved and AlertSendFailed events as batches move
+// through the queue.
+func NewNotifier(cfg NotifierConfig, metrics *NotifierMetrics, observer Observer, logger *slog.Logger) *Notifier {
+	return &Notifier{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.SendTimeout},
+		metrics:  metrics,
+		observer: observer,
+		logger:   logger,
+		queues:   map[string]chan queuedAlerts{},
+	}
+}
+
+// Run starts Workers worker goroutines per alertmanager and blocks until
+// stopc is closed.
+func (n *Notifier) Run(alertmanagers []string, stopc <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, am := range alertmanagers {
+		q := n.queueFor(am)
+		for i := 0; i < n.cfg.Workers; i++ {
+			wg.Add(1)
+			go func(am string) {
+				defer wg.Done()
+				n.worker(am, q, stopc)
+			}(am)
+		}
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) queueFor(am string) chan queuedAlerts {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	q, ok := n.queues[am]
+	if !ok {
+		q = make(chan queuedAlerts, n.cfg.QueueCapacity)
+		n.queues[am] = q
+	}
+	return q
+}
+
+// Send enqueues alerts for delivery to am. If the queue is full the alerts
+// are dropped and counted rather than blocking the caller.
+func (n *Notifier) Send(am string, alerts []*Alert) {
+	kind := alertKindFire
+	if len(alerts) > 0 && alerts[0].EndsAt != nil {
+		kind = alertKindResolve
+	}
+
+	q := n.queueFor(am)
+	select {
+	case q <- queuedAlerts{kind: kind, alerts: alerts}:
+		n.metrics.queueLength.WithLabelValues(am).Set(float64(len(q)))
+		n.observer.Observe(AlertQueued, alerts, map[string]interface{}{"alertmanager": am})
+	default:
+		n.metrics.dropped.WithLabelValues(am).Add(float64(len(alerts)))
+		n.observer.Observe(AlertSendFailed, alerts, map[string]interface{}{"alertmanager": am, "reason": "queue_full"})
+	}
+}
+
+// worker drains q into batches for sendWithRetry. It only coalesces queued
+// items that share a kind, so a fire batch and a resolve batch queued back
+// to back are never merged into one send and misreported as the other's
+// event type.
+func (n *Notifier) worker(am string, q chan queuedAlerts, stopc <-chan struct{}) {
+	var leftover *queuedAlerts
+	for {
+		var first queuedAlerts
+		if leftover != nil {
+			first, leftover = *leftover, nil
+		} else {
+			select {
+			case first = <-q:
+			case <-stopc:
+				return
+			}
+		}
+
+		kind := first.kind
+		batch := append([]*Alert{}, first.alerts...)
+
+	drain:
+		for len(batch) < n.cfg.MaxBatchSize {
+			select {
+			case next := <-q:
+				if next.kind != kind {
+					leftover = &next
+					break drain
+				}
+				batch = append(batch, next.alerts...)
+			default:
+				break drain
+			}
+		}
+
+		n.metrics.queueLength.WithLabelValues(am).Set(float64(len(q)))
+		n.sendWithRetry(am, kind, batch)
+	}
+}
+
+func (n *Notifier) sendWithRetry(am string, kind alertKind, alerts []*Alert) {
+	backoff := n.cfg.RetryBackoff
+	var err error
+
+	for attempt := 0; attempt <= maxSendRetries; attempt++ {
+		if attempt > 0 {
+			n.metrics.retries.WithLabelValues(am).Inc()
+			jitter := time.Duration(rand.Int63n(int64(backoff) + 1))
+			time.Sleep(backoff + jitter)
+			backoff *= 2
+		}
+
+		start := time.Now()
+		var statusCode int
+		statusCode, err = n.send(am, alerts)
+		n.metrics.sendDuration.WithLabelValues(am).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			event := AlertSent
+			if kind == alertKindResolve {
+				event = AlertResolved
+			}
+			n.observer.Observe(event, alerts, map[string]interface{}{"alertmanager": am, "timestamp": time.Now(), "statusCode": statusCode})
+			return
+		}
+	}
+
+	n.logger.Warn("giving up sending alerts", "alerts", len(alerts), "alertmanager", am, "attempts", maxSendRetries+1, "error", err)
+	n.metrics.dropped.WithLabelValues(am).Add(float64(len(alerts)))
+	n.observer.Observe(AlertSendFailed, alerts, map[string]interface{}{"alertmanager": am, "reason": "retries_exhausted", "error": err.Error()})
+}
+
+func (n *Notifier) send(am string, alerts []*Alert) (int, error) {
+	b := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(b).Encode(alerts); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.SendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, am, b)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, am)
+	}
+
+	return resp.StatusCode, nil
+}
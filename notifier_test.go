@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type recordingObserver struct {
+	mtx    sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	if event != AlertSent && event != AlertResolved {
+		return
+	}
+	o.mtx.Lock()
+	o.events = append(o.events, event)
+	o.mtx.Unlock()
+}
+
+func TestNotifierWorkerDoesNotCoalesceFireAndResolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	obs := &recordingObserver{}
+	reg := prometheus.NewRegistry()
+	n := NewNotifier(NotifierConfig{
+		QueueCapacity: 10,
+		MaxBatchSize:  10,
+		SendTimeout:   time.Second,
+		RetryBackoff:  time.Millisecond,
+		Workers:       1,
+	}, NewNotifierMetrics(reg), obs, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	stopc := make(chan struct{})
+	go n.worker(srv.URL, n.queueFor(srv.URL), stopc)
+	defer close(stopc)
+
+	endsAt := time.Now()
+	n.Send(srv.URL, []*Alert{{Labels: map[string]string{"a": "1"}}})
+	n.Send(srv.URL, []*Alert{{Labels: map[string]string{"a": "1"}, EndsAt: &endsAt}})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		obs.mtx.Lock()
+		got := len(obs.events)
+		obs.mtx.Unlock()
+		if got >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for both events, got %v", obs.events)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	obs.mtx.Lock()
+	defer obs.mtx.Unlock()
+	if len(obs.events) != 2 || obs.events[0] != AlertSent || obs.events[1] != AlertResolved {
+		t.Fatalf("expected [AlertSent, AlertResolved], got %v", obs.events)
+	}
+}
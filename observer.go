@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Well-known lifecycle events observers can be notified of.
+const (
+	AlertQueued              = "AlertQueued"
+	AlertSent                = "AlertSent"
+	AlertSendFailed          = "AlertSendFailed"
+	AlertResolved            = "AlertResolved"
+	NotificationReceived     = "NotificationReceived"
+	NotificationDecodeFailed = "NotificationDecodeFailed"
+)
+
+// Observer is notified of alert and notification lifecycle events as they
+// happen, decoupling the fixed in-memory report path from the places that
+// actually fire and receive alerts.
+type Observer interface {
+	Observe(event string, alerts []*Alert, meta map[string]interface{})
+}
+
+// Observers fans a single lifecycle event out to every observer in the
+// slice, so a run can be configured with more than one sink.
+type Observers []Observer
+
+func (os Observers) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	for _, o := range os {
+		o.Observe(event, alerts, meta)
+	}
+}
+
+// EventStoreObserver replays AlertSent/AlertResolved events into an
+// alertsFiredEventStore and NotificationReceived events into a
+// notificationList, preserving ambench's original in-memory report path as
+// just another observer.
+type EventStoreObserver struct {
+	alerts        *alertsFiredEventStore
+	notifications *notificationList
+	alertsFired   *prometheus.CounterVec
+}
+
+func NewEventStoreObserver(alerts *alertsFiredEventStore, notifications *notificationList, alertsFired *prometheus.CounterVec) *EventStoreObserver {
+	return &EventStoreObserver{alerts: alerts, notifications: notifications, alertsFired: alertsFired}
+}
+
+func (o *EventStoreObserver) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	switch event {
+	case AlertSent, AlertResolved:
+		am, _ := meta["alertmanager"].(string)
+		sentAt, ok := meta["timestamp"].(time.Time)
+		if !ok {
+			sentAt = time.Now()
+		}
+		statusCode, ok := meta["statusCode"].(int)
+		if !ok {
+			statusCode = 200
+		}
+		eventType := "FIRE"
+		if event == AlertResolved {
+			eventType = "RESOLVE"
+		}
+		o.alertsFired.WithLabelValues(am, strconv.Itoa(statusCode)).Inc()
+		o.alerts.Add(&alertsFiredEvent{alertmanager: am, alerts: alerts, timestamp: sentAt, eventType: eventType})
+	case NotificationReceived:
+		am, _ := meta["alertmanager"].(string)
+		groupKey, _ := meta["groupKey"].(string)
+		hash, _ := meta["hash"].(uint64)
+		hashes, _ := meta["alertHashes"].([]uint64)
+		var latency *int64
+		if ns, ok := meta["latency_ns"].(int64); ok {
+			latency = &ns
+		}
+		o.notifications.Add(&notification{
+			timestamp:        time.Now(),
+			alertmanager:     am,
+			groupKey:         groupKey,
+			notificationHash: hash,
+			alerts:           hashes,
+			latencyNanos:     latency,
+		})
+	}
+}
+
+// jsonLinesEvent is the shape written by a JSONLinesObserver, one per line.
+type jsonLinesEvent struct {
+	Event     string                 `json:"event"`
+	Timestamp time.Time              `json:"timestamp"`
+	Alerts    []uint64               `json:"alert_hashes,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+}
+
+// JSONLinesObserver streams every observed event as one JSON object per
+// line to an io.Writer, for downstream analyzers that don't want to parse
+// the text report.
+type JSONLinesObserver struct {
+	mtx *sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesObserver(w io.Writer) *JSONLinesObserver {
+	return &JSONLinesObserver{
+		mtx: &sync.Mutex{},
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (o *JSONLinesObserver) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.enc.Encode(jsonLinesEvent{
+		Event:     event,
+		Timestamp: time.Now(),
+		Alerts:    alertHashes(alerts),
+		Meta:      meta,
+	})
+}
+
+// PrometheusObserver maintains counters and histograms for lifecycle
+// events, labeled by event type, so a run's sinks can be swapped between
+// plain Prometheus scraping and custom observers without touching the core
+// loop.
+type PrometheusObserver struct {
+	events    *prometheus.CounterVec
+	batchSize *prometheus.HistogramVec
+}
+
+func NewPrometheusObserver(reg prometheus.Registerer) *PrometheusObserver {
+	o := &PrometheusObserver{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ambench_observer_events_total",
+			Help: "Number of lifecycle events observed, by event type.",
+		}, []string{"event"}),
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ambench_observer_batch_size",
+			Help:    "Size of the alert batch associated with an observed event.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"event"}),
+	}
+	reg.MustRegister(o.events, o.batchSize)
+	return o
+}
+
+func (o *PrometheusObserver) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	o.events.WithLabelValues(event).Inc()
+	o.batchSize.WithLabelValues(event).Observe(float64(len(alerts)))
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// ProbeSettings configures an AlertmanagerProbe from YAML, under the
+// "probe" key of a LoadTestConfig.
+type ProbeSettings struct {
+	Interval    model.Duration   `yaml:"interval"`
+	Timeout     model.Duration   `yaml:"timeout"`
+	BasicAuth   *BasicAuthConfig `yaml:"basic_auth"`
+	BearerToken string           `yaml:"bearer_token"`
+}
+
+// BasicAuthConfig holds HTTP basic auth credentials for probing an
+// alertmanager.
+type BasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+const (
+	defaultProbeInterval = 30 * time.Second
+	defaultProbeTimeout  = 10 * time.Second
+)
+
+// ProbeConfig is the resolved, defaulted configuration for an
+// AlertmanagerProbe.
+type ProbeConfig struct {
+	Interval      time.Duration
+	Timeout       time.Duration
+	BasicAuthUser string
+	BasicAuthPass string
+	BearerToken   string
+}
+
+func (s *ProbeSettings) resolve() ProbeConfig {
+	cfg := ProbeConfig{
+		Interval:    time.Duration(s.Interval),
+		Timeout:     time.Duration(s.Timeout),
+		BearerToken: s.BearerToken,
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultProbeInterval
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultProbeTimeout
+	}
+	if s.BasicAuth != nil {
+		cfg.BasicAuthUser = s.BasicAuth.Username
+		cfg.BasicAuthPass = s.BasicAuth.Password
+	}
+	return cfg
+}
+
+// ProbeMetrics are the Prometheus metrics shared by every
+// AlertmanagerProbe across a run.
+type ProbeMetrics struct {
+	active       *prometheus.GaugeVec
+	suppressed   *prometheus.GaugeVec
+	firedNotInAM *prometheus.CounterVec
+}
+
+// NewProbeMetrics creates and registers the metrics an AlertmanagerProbe
+// reports.
+func NewProbeMetrics(reg prometheus.Registerer) *ProbeMetrics {
+	m := &ProbeMetrics{
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ambench_am_active_alerts",
+			Help: "Number of active alerts an alertmanager reports, as last observed by the probe.",
+		}, []string{"alertmanager"}),
+		suppressed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ambench_am_suppressed_alerts",
+			Help: "Number of suppressed alerts an alertmanager reports, as last observed by the probe.",
+		}, []string{"alertmanager"}),
+		firedNotInAM: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ambench_fired_not_in_am_total",
+			Help: "Number of alerts ambench fired that were not found in an alertmanager's alerts within one probe interval.",
+		}, []string{"alertmanager"}),
+	}
+	reg.MustRegister(m.active, m.suppressed, m.firedNotInAM)
+	return m
+}
+
+// gettableAlert is the subset of Alertmanager's v2 GettableAlert model that
+// the probe needs.
+type gettableAlert struct {
+	Labels map[string]string `json:"labels"`
+	Status struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// probeEvent records one alertmanager's state as observed by a single
+// probe tick, for the merged text report.
+type probeEvent struct {
+	timestamp    time.Time
+	alertmanager string
+	active       int
+	suppressed   int
+	firedNotInAM int
+}
+
+func (e *probeEvent) Print(out io.Writer) {
+	fmt.Fprintf(out, "%-12s ", "PROBE")
+	fmt.Fprint(out, e.timestamp.UTC().Format(TimeFormat), " ")
+	fmt.Fprint(out, e.alertmanager, " ")
+	fmt.Fprintf(out, "active=%d suppressed=%d fired_not_in_am=%d", e.active, e.suppressed, e.firedNotInAM)
+	fmt.Fprint(out, "\n")
+}
+
+func (e *probeEvent) Timestamp() time.Time {
+	return e.timestamp
+}
+
+func (e *probeEvent) JSON() jsonReportEvent {
+	return jsonReportEvent{
+		Type:         "PROBE",
+		TsNanos:      e.timestamp.UnixNano(),
+		Alertmanager: e.alertmanager,
+		Active:       e.active,
+		Suppressed:   e.suppressed,
+		FiredNotInAM: e.firedNotInAM,
+	}
+}
+
+type probeEventStore struct {
+	mtx    *sync.Mutex
+	events []*probeEvent
+}
+
+func newProbeEventStore() *probeEventStore {
+	return &probeEventStore{events: []*probeEvent{}, mtx: &sync.Mutex{}}
+}
+
+func (s *probeEventStore) Add(e *probeEvent) {
+	s.mtx.Lock()
+	s.events = append(s.events, e)
+	s.mtx.Unlock()
+}
+
+func (s *probeEventStore) All() []*probeEvent {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	events := make([]*probeEvent, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// probeEventsSorted returns a time-sorted snapshot of a probeEventStore for
+// merging into the report.
+func probeEventsSorted(store *probeEventStore) []Event {
+	events := store.All()
+	e := make([]Event, len(events))
+	for i, ev := range events {
+		e[i] = Event(ev)
+	}
+	return e
+}
+
+// AlertmanagerProbe periodically polls each alertmanager's v2 API and
+// diffs the fingerprints it finds there against what the load test claims
+// to have fired, to catch silent drops inside AM (rejected, inhibited or
+// GC'd alerts) that the webhook path alone would never see. It also
+// implements Observer so it can track fires the same way the correlation
+// subsystem does.
+type AlertmanagerProbe struct {
+	cfg     ProbeConfig
+	client  *http.Client
+	metrics *ProbeMetrics
+	logger  *slog.Logger
+	fired   *correlationLRU
+	store   *probeEventStore
+}
+
+func NewAlertmanagerProbe(cfg ProbeConfig, metrics *ProbeMetrics, logger *slog.Logger) *AlertmanagerProbe {
+	return &AlertmanagerProbe{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		metrics: metrics,
+		logger:  logger,
+		fired:   newCorrelationLRU(defaultCorrelationCapacity),
+		store:   newProbeEventStore(),
+	}
+}
+
+func (p *AlertmanagerProbe) Observe(event string, alerts []*Alert, meta map[string]interface{}) {
+	if event != AlertSent && event != AlertResolved {
+		return
+	}
+	am, _ := meta["alertmanager"].(string)
+	sentAt, ok := meta["timestamp"].(time.Time)
+	if !ok {
+		sentAt = time.Now()
+	}
+	for _, a := range alerts {
+		p.fired.Put(hashAlert(a), baseAlertmanager(am), sentAt)
+	}
+}
+
+// baseAlertmanager strips the versioned alerts path the Notifier sends to
+// (e.g. "/api/v2/alerts"), so a fire recorded by Observe keys on the same
+// bare alertmanager URL probeAll polls.
+func baseAlertmanager(endpoint string) string {
+	for _, suffix := range []string{"/api/v1/alerts", "/api/v2/alerts"} {
+		if strings.HasSuffix(endpoint, suffix) {
+			return strings.TrimSuffix(endpoint, suffix)
+		}
+	}
+	return endpoint
+}
+
+// Run polls every alertmanager in alertmanagers on cfg.Interval until
+// stopc is closed.
+func (p *AlertmanagerProbe) Run(alertmanagers []string, stopc <-chan struct{}) {
+	t := time.NewTicker(p.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.probeAll(alertmanagers)
+		case <-stopc:
+			return
+		}
+	}
+}
+
+func (p *AlertmanagerProbe) probeAll(alertmanagers []string) {
+	now := time.Now()
+
+	seenByAM := map[string]map[uint64]struct{}{}
+	activeByAM := map[string]int{}
+	suppressedByAM := map[string]int{}
+
+	for _, am := range alertmanagers {
+		alerts, err := p.fetchAlerts(am)
+		if err != nil {
+			p.logger.Warn("failed to query alerts", "alertmanager", am, "error", err)
+			continue
+		}
+		p.fetchGroups(am)
+		p.fetchStatus(am)
+
+		seen := make(map[uint64]struct{}, len(alerts))
+		active, suppressed := 0, 0
+		for _, a := range alerts {
+			seen[hashAlert(&Alert{Labels: a.Labels})] = struct{}{}
+			if a.Status.State == "suppressed" {
+				suppressed++
+			} else {
+				active++
+			}
+		}
+
+		seenByAM[am] = seen
+		activeByAM[am] = active
+		suppressedByAM[am] = suppressed
+		p.metrics.active.WithLabelValues(am).Set(float64(active))
+		p.metrics.suppressed.WithLabelValues(am).Set(float64(suppressed))
+	}
+
+	missingByAM := map[string]int{}
+	grace := now.Add(-p.cfg.Interval)
+	for _, entry := range p.fired.PopOlderThan(grace) {
+		seen, probed := seenByAM[entry.alertmanager]
+		if !probed {
+			// This AM's own fetchAlerts failed this tick, so we never
+			// learned whether it holds the alert; re-queue rather than
+			// drop, so it's checked against a later, successful probe.
+			p.fired.Put(entry.hash, entry.alertmanager, entry.sentAt)
+			continue
+		}
+		if _, ok := seen[entry.hash]; !ok {
+			missingByAM[entry.alertmanager]++
+			p.metrics.firedNotInAM.WithLabelValues(entry.alertmanager).Inc()
+		}
+	}
+
+	for am, active := range activeByAM {
+		p.store.Add(&probeEvent{
+			timestamp:    now,
+			alertmanager: am,
+			active:       active,
+			suppressed:   suppressedByAM[am],
+			firedNotInAM: missingByAM[am],
+		})
+	}
+}
+
+func (p *AlertmanagerProbe) authenticate(req *http.Request) {
+	switch {
+	case p.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	case p.cfg.BasicAuthUser != "":
+		req.SetBasicAuth(p.cfg.BasicAuthUser, p.cfg.BasicAuthPass)
+	}
+}
+
+func (p *AlertmanagerProbe) get(am, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(am, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.authenticate(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d from %s%s", resp.StatusCode, am, path)
+	}
+	return resp, nil
+}
+
+func (p *AlertmanagerProbe) fetchAlerts(am string) ([]gettableAlert, error) {
+	resp, err := p.get(am, "/api/v2/alerts")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var alerts []gettableAlert
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// fetchGroups and fetchStatus validate the same endpoints a dashboard or
+// operator would hit, even though ambench doesn't yet derive metrics from
+// their payloads.
+func (p *AlertmanagerProbe) fetchGroups(am string) {
+	resp, err := p.get(am, "/api/v2/alerts/groups")
+	if err != nil {
+		p.logger.Warn("failed to query alert groups", "alertmanager", am, "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (p *AlertmanagerProbe) fetchStatus(am string) {
+	resp, err := p.get(am, "/api/v2/status")
+	if err != nil {
+		p.logger.Warn("failed to query status", "alertmanager", am, "error", err)
+		return
+	}
+	resp.Body.Close()
+}
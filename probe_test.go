@@ -0,0 +1,25 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProbeAllRequeuesFiredEntryWhenFetchFails(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cfg := ProbeConfig{Interval: time.Millisecond, Timeout: time.Millisecond}
+	p := NewAlertmanagerProbe(cfg, NewProbeMetrics(reg), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	old := time.Now().Add(-time.Hour)
+	p.fired.Put(12345, "http://127.0.0.1:0", old)
+
+	p.probeAll([]string{"http://127.0.0.1:0"})
+
+	if _, ok := p.fired.Peek(12345); !ok {
+		t.Fatalf("expected entry to be re-queued after a failed fetch, but it was dropped")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"sort"
@@ -19,6 +19,7 @@ type WebhookReceiver struct {
 	notificationsReceived *prometheus.CounterVec
 	out                   io.Writer
 	notifications         *notificationList
+	observer              Observer
 }
 
 type notificationList struct {
@@ -45,6 +46,7 @@ type notification struct {
 	groupKey         string
 	notificationHash uint64
 	alerts           []uint64
+	latencyNanos     *int64
 }
 
 func (n *notification) Print(out io.Writer) {
@@ -63,19 +65,60 @@ func (n *notification) Timestamp() time.Time {
 	return n.timestamp
 }
 
+func (n *notification) JSON() jsonReportEvent {
+	hashes := make([]string, len(n.alerts))
+	for i, h := range n.alerts {
+		hashes[i] = fmt.Sprintf("%x", h)
+	}
+	return jsonReportEvent{
+		Type:             "NOTIFICATION",
+		TsNanos:          n.timestamp.UnixNano(),
+		Alertmanager:     n.alertmanager,
+		GroupKey:         n.groupKey,
+		NotificationHash: fmt.Sprintf("%x", n.notificationHash),
+		AlertHashes:      hashes,
+		LatencyNanos:     n.latencyNanos,
+	}
+}
+
 type Event interface {
 	Print(io.Writer)
 	Timestamp() time.Time
+	JSON() jsonReportEvent
+}
+
+// jsonReportEvent is the machine-readable shape every Event renders to for
+// report.jsonl, the source of truth for downstream analyzers; the text
+// report stays human-oriented.
+type jsonReportEvent struct {
+	Type             string   `json:"type"`
+	TsNanos          int64    `json:"ts_ns"`
+	Alertmanager     string   `json:"alertmanager,omitempty"`
+	GroupKey         string   `json:"group_key,omitempty"`
+	NotificationHash string   `json:"notification_hash,omitempty"`
+	AlertHashes      []string `json:"alert_hashes,omitempty"`
+	LatencyNanos     *int64   `json:"latency_ns,omitempty"`
+	Active           int      `json:"active,omitempty"`
+	Suppressed       int      `json:"suppressed,omitempty"`
+	FiredNotInAM     int      `json:"fired_not_in_am,omitempty"`
 }
 
 func NewWebhookReceiver(c *prometheus.CounterVec) *WebhookReceiver {
 	return &WebhookReceiver{
 		notificationsReceived: c,
-		out:           os.Stdout,
-		notifications: newNotificationList(),
+		out:                   os.Stdout,
+		notifications:         newNotificationList(),
+		observer:              Observers{},
 	}
 }
 
+// SetObserver swaps the Observer notified by Handler, so each load test run
+// can compose its own set of sinks alongside the long-lived webhook
+// receiver.
+func (wr *WebhookReceiver) SetObserver(o Observer) {
+	wr.observer = o
+}
+
 type WebhookData struct {
 	GroupKey    string   `json:"groupKey"`
 	ExternalURL string   `json:"externalURL"`
@@ -90,22 +133,32 @@ func (wr *WebhookReceiver) Events() []Event {
 	return e
 }
 
+// ResetEvents clears the notifications recorded so far, so the same
+// receiver can be reused for the next load test's run.
+func (wr *WebhookReceiver) ResetEvents() {
+	wr.notifications.mtx.Lock()
+	wr.notifications.notifications = []*notification{}
+	wr.notifications.mtx.Unlock()
+}
+
 func (wr *WebhookReceiver) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data := WebhookData{}
 		err := json.NewDecoder(r.Body).Decode(&data)
 		if err != nil {
-			log.Println("Could not decode json", err)
+			slog.Error("failed to decode webhook payload", "error", err)
+			wr.observer.Observe(NotificationDecodeFailed, nil, map[string]interface{}{"error": err.Error()})
+			w.WriteHeader(http.StatusBadRequest)
+			return
 		}
 		alertHashes := alertHashes(data.Alerts)
 		hash := hashHashes(alertHashes)
 		wr.notificationsReceived.WithLabelValues(data.GroupKey, data.ExternalURL, fmt.Sprintf("%x", hash)).Inc()
-		wr.notifications.Add(&notification{
-			timestamp:        time.Now(),
-			alertmanager:     data.ExternalURL,
-			groupKey:         data.GroupKey,
-			notificationHash: hash,
-			alerts:           alertHashes,
+		wr.observer.Observe(NotificationReceived, data.Alerts, map[string]interface{}{
+			"alertmanager": data.ExternalURL,
+			"groupKey":     data.GroupKey,
+			"hash":         hash,
+			"alertHashes":  alertHashes,
 		})
 
 		w.WriteHeader(http.StatusOK)